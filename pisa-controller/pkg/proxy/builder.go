@@ -0,0 +1,343 @@
+// Copyright 2022 SphereEx Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/database-mesh/golang-sdk/client"
+)
+
+// ProxyBuilder assembles the dataplane-facing Proxy configuration from the
+// CRDs that describe it: the VirtualDatabaseService the proxy fronts, the
+// TrafficStrategy that governs load balancing/splitting/plugins, and the
+// DatabaseEndpoints it may route to.
+type ProxyBuilder struct {
+	VirtualDatabaseService client.VirtualDatabaseService
+	TrafficStrategy        client.TrafficStrategy
+	DatabaseEndpoints      []client.DatabaseEndpoint
+
+	// CatalogClient resolves writer/reader endpoints from an external
+	// service catalog (Consul KV/health, etcd). It is only consulted when
+	// the TrafficStrategy configures a ServiceCatalogDiscovery; production
+	// callers inject a concrete client wired to the catalog address. Nil
+	// means endpoint discovery falls back to DatabaseEndpoints as before.
+	CatalogClient CatalogClient
+}
+
+// CatalogClient resolves the current writer/reader set for a service from
+// an external catalog, along with the blocking-query index to resume from
+// on the next poll.
+type CatalogClient interface {
+	Resolve(cfg *client.ServiceCatalogDiscovery) (writers, readers []string, index uint64, err error)
+}
+
+func (b *ProxyBuilder) Build() *Proxy {
+	proxy := &Proxy{
+		Name: b.VirtualDatabaseService.Name,
+	}
+
+	switch {
+	case b.VirtualDatabaseService.DatabaseMySQL != nil:
+		mysql := b.VirtualDatabaseService.DatabaseMySQL
+		proxy.BackendType = BackendTypeMySQL
+		proxy.DB = mysql.DB
+		proxy.User = mysql.User
+		proxy.Password = mysql.Password
+		proxy.ServerVersion = mysql.ServerVersion
+		proxy.PoolSize = mysql.PoolSize
+		proxy.ListenAddr = fmt.Sprintf("%s:%d", mysql.Host, mysql.Port)
+	case b.VirtualDatabaseService.DatabasePostgreSQL != nil:
+		pg := b.VirtualDatabaseService.DatabasePostgreSQL
+		proxy.BackendType = BackendTypePostgreSQL
+		proxy.DB = pg.DB
+		proxy.User = pg.User
+		proxy.Password = pg.Password
+		proxy.ServerVersion = pg.ServerVersion
+		proxy.PoolSize = pg.PoolSize
+		proxy.ListenAddr = fmt.Sprintf("%s:%d", pg.Host, pg.Port)
+		proxy.SSLMode = pg.SSLMode
+		proxy.ApplicationName = pg.ApplicationName
+		proxy.SearchPath = pg.SearchPath
+	}
+
+	lb := b.TrafficStrategy.Spec.LoadBalance
+	if lb != nil {
+		if lb.SimpleLoadBalance != nil {
+			proxy.SimpleLoadBalance = b.buildSimpleLoadBalance(lb.SimpleLoadBalance)
+		}
+		if lb.ReadWriteSplitting != nil {
+			proxy.ReadWriteSplitting = b.buildReadWriteSplitting(lb.ReadWriteSplitting, proxy.BackendType)
+			if bindings := buildPlanBindings(lb.ReadWriteSplitting); len(bindings) > 0 {
+				proxy.PlanBindings = bindings
+			}
+		}
+	}
+
+	if plugin := b.buildPlugin(); plugin != nil {
+		proxy.Plugin = plugin
+	}
+
+	if metrics := b.buildMetrics(); metrics != nil {
+		proxy.Metrics = metrics
+	}
+
+	return proxy
+}
+
+// buildMetrics translates the TrafficStrategy's Metrics block, if any, into
+// the proxy's scrape-endpoint configuration.
+func (b *ProxyBuilder) buildMetrics() *Metrics {
+	m := b.TrafficStrategy.Spec.Metrics
+	if m == nil {
+		return nil
+	}
+
+	metrics := &Metrics{
+		ListenAddr: m.ListenAddr,
+		Path:       m.Path,
+	}
+
+	if pe := m.PrometheusExporter; pe != nil {
+		metrics.PrometheusExporter = &PrometheusExporter{}
+		if pe.TLS != nil {
+			metrics.PrometheusExporter.TLS = &TLSConfig{
+				CAFile:         pe.TLS.CAFile,
+				CertFile:       pe.TLS.CertFile,
+				KeyFile:        pe.TLS.KeyFile,
+				ClientAuthType: pe.TLS.ClientAuthType,
+			}
+		}
+	}
+
+	return metrics
+}
+
+// buildSimpleLoadBalance resolves the DatabaseEndpoints whose labels match the
+// TrafficStrategy selector's MatchLabels into the node list the balancer
+// should spread traffic across. The selector's MatchExpressions are not
+// evaluated.
+func (b *ProxyBuilder) buildSimpleLoadBalance(lb *client.SimpleLoadBalance) *SimpleLoadBalance {
+	return &SimpleLoadBalance{
+		BalancerType: string(lb.Kind),
+		Nodes:        b.selectedEndpointNames(),
+	}
+}
+
+func (b *ProxyBuilder) selectedEndpointNames() []string {
+	selector := b.TrafficStrategy.Spec.Selector
+	nodes := make([]string, 0, len(b.DatabaseEndpoints))
+	for _, ep := range b.DatabaseEndpoints {
+		if selector != nil && !labelsMatch(selector.MatchLabels, ep.Labels) {
+			continue
+		}
+		nodes = append(nodes, ep.Name)
+	}
+	return nodes
+}
+
+func labelsMatch(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *ProxyBuilder) buildReadWriteSplitting(rws *client.ReadWriteSplitting, backendType string) *ReadWriteSplitting {
+	out := &ReadWriteSplitting{}
+	if rws.Static != nil {
+		out.Static = &ReadWriteSplittingStatic{
+			DefaultTarget: rws.Static.DefaultTarget,
+			Rules:         buildReadWriteSplittingRules(rws.Static.Rules, backendType),
+		}
+	}
+	if rws.Dynamic != nil {
+		dynamic := &ReadWriteSplittingDynamic{
+			DefaultTarget: rws.Dynamic.DefaultTarget,
+			Rules:         buildReadWriteSplittingRules(rws.Dynamic.Rules, backendType),
+			Discovery:     buildReadWriteDiscovery(rws.Dynamic.Discovery, backendType),
+		}
+		if scd := rws.Dynamic.Discovery.ServiceCatalogDiscovery; scd != nil && b.CatalogClient != nil {
+			b.resolveFromCatalog(scd, dynamic)
+		}
+		if c := rws.Dynamic.Corrector; c != nil {
+			dynamic.Corrector = &Corrector{
+				Interval:            c.Interval,
+				BatchSize:           c.BatchSize,
+				Concurrency:         c.Concurrency,
+				DivergenceThreshold: c.DivergenceThreshold,
+				Action:              c.Action,
+				TableIncludeRegex:   c.TableIncludeRegex,
+				TableExcludeRegex:   c.TableExcludeRegex,
+			}
+		}
+		out.Dynamic = dynamic
+	}
+	return out
+}
+
+// resolveFromCatalog short-circuits discovery from DatabaseEndpoints: instead
+// of probing statically declared CRs, it asks the catalog for the current
+// writer/reader set and uses that to populate the dynamic splitting groups.
+// It never writes back into the caller-owned *client.ServiceCatalogDiscovery
+// CRD struct; the refreshed wait index is recorded only on the already-built
+// output, which is safe to do even if Build() runs concurrently or the
+// TrafficStrategy is reused across reconciliations.
+func (b *ProxyBuilder) resolveFromCatalog(scd *client.ServiceCatalogDiscovery, dynamic *ReadWriteSplittingDynamic) {
+	writers, readers, index, err := b.CatalogClient.Resolve(scd)
+	if err != nil {
+		return
+	}
+	dynamic.Discovery.ServiceCatalogDiscovery.WaitIndex = index
+	dynamic.WriteNodes = writers
+	dynamic.ReadNodes = readers
+}
+
+// buildPlanBindings walks every "binding"-type rule across both the static
+// and dynamic splitting groups and precomputes each bound statement's SQL
+// digest, so the dataplane can route by exact digest match before falling
+// back to a rule's regex.
+func buildPlanBindings(rws *client.ReadWriteSplitting) map[string]PlanBinding {
+	bindings := map[string]PlanBinding{}
+	if rws.Static != nil {
+		collectPlanBindings(rws.Static.Rules, bindings)
+	}
+	if rws.Dynamic != nil {
+		collectPlanBindings(rws.Dynamic.Rules, bindings)
+	}
+	return bindings
+}
+
+func collectPlanBindings(rules []client.ReadWriteSplittingRule, bindings map[string]PlanBinding) {
+	for _, r := range rules {
+		if r.Type != "binding" {
+			continue
+		}
+		for _, sb := range r.Bindings {
+			bindings[SQLDigest(sb.SQL)] = PlanBinding{
+				Target:        sb.Target,
+				AlgorithmName: sb.AlgorithmName,
+			}
+		}
+	}
+}
+
+func buildReadWriteSplittingRules(rules []client.ReadWriteSplittingRule, backendType string) []ReadWriteSplittingRule {
+	out := make([]ReadWriteSplittingRule, 0, len(rules))
+	for _, r := range rules {
+		rule := ReadWriteSplittingRule{
+			Name:          r.Name,
+			Regex:         r.Regex,
+			Target:        r.Target,
+			Type:          r.Type,
+			ExcludeRegex:  r.ExcludeRegex,
+			AlgorithmName: r.AlgorithmName,
+		}
+		if rule.Type == "regex" && len(rule.Regex) == 0 && rule.Target == ReadWriteSplittingRoleRead {
+			rule.Regex, rule.ExcludeRegex = defaultReadRegex(backendType)
+		}
+		out = append(out, rule)
+	}
+	return out
+}
+
+// defaultReadRegex returns the backend-specific regex a "read" rule falls
+// back to when the CRD doesn't declare one explicitly. PostgreSQL additionally
+// routes CTEs that terminate in a select, while excluding "select ... for
+// update" so row-locking reads still land on the writer.
+func defaultReadRegex(backendType string) (include, exclude []string) {
+	if backendType == BackendTypePostgreSQL {
+		return []string{"^select", "^with .* select"}, []string{"select .* for update"}
+	}
+	return []string{"^select"}, nil
+}
+
+func buildReadWriteDiscovery(d client.ReadWriteDiscovery, backendType string) ReadWriteDiscovery {
+	mha := d.MasterHighAvailability
+	if mha == nil {
+		return ReadWriteDiscovery{ServiceCatalogDiscovery: buildServiceCatalogDiscovery(d.ServiceCatalogDiscovery)}
+	}
+
+	out := &MasterHighAvailablity{
+		Type:            "mha",
+		BackendType:     backendType,
+		User:            mha.User,
+		Password:        mha.Password,
+		MonitorInterval: mha.MonitorInterval,
+	}
+
+	if p := mha.ConnectionProbe; p != nil && p.Probe != nil {
+		out.ConnectInterval = p.Probe.PeriodMilliseconds
+		out.ConnectTimeout = p.Probe.TimeoutMilliseconds
+		out.ConnectMaxFailures = p.Probe.FailureThreshold
+	}
+	if p := mha.PingProbe; p != nil && p.Probe != nil {
+		out.PingInterval = p.Probe.PeriodMilliseconds
+		out.PingTimeout = p.Probe.TimeoutMilliseconds
+		out.PingMaxFailures = p.Probe.FailureThreshold
+	}
+	if p := mha.ReplicationLagProbe; p != nil && p.Probe != nil {
+		out.ReplicationLagInterval = p.Probe.PeriodMilliseconds
+		out.ReplicationLagTimeout = p.Probe.TimeoutMilliseconds
+		out.ReplicationLagMaxFailures = p.Probe.FailureThreshold
+		out.MaxReplicationLag = p.MaxReplicationLag
+	}
+	if p := mha.ReadOnlyProbe; p != nil && p.Probe != nil {
+		out.ReadOnlyInterval = p.Probe.PeriodMilliseconds
+		out.ReadOnlyTimeout = p.Probe.TimeoutMilliseconds
+		out.ReadOnlyMaxFailures = p.Probe.FailureThreshold
+	}
+
+	return ReadWriteDiscovery{
+		MasterHighAvailablity:   out,
+		ServiceCatalogDiscovery: buildServiceCatalogDiscovery(d.ServiceCatalogDiscovery),
+	}
+}
+
+func buildServiceCatalogDiscovery(scd *client.ServiceCatalogDiscovery) *ServiceCatalogDiscovery {
+	if scd == nil {
+		return nil
+	}
+	return &ServiceCatalogDiscovery{
+		Address:     scd.Address,
+		ACLToken:    scd.ACLToken,
+		ServiceName: scd.ServiceName,
+		WriterTag:   scd.WriterTag,
+		ReaderTag:   scd.ReaderTag,
+		WaitIndex:   scd.WaitIndex,
+	}
+}
+
+func (b *ProxyBuilder) buildPlugin() *Plugin {
+	cbs := b.TrafficStrategy.Spec.CircuitBreaks
+	ccs := b.TrafficStrategy.Spec.ConcurrencyControls
+	if len(cbs) == 0 && len(ccs) == 0 {
+		return nil
+	}
+
+	plugin := &Plugin{}
+	for _, cb := range cbs {
+		plugin.CircuitBreaks = append(plugin.CircuitBreaks, CircuitBreak{Regex: cb.Regex})
+	}
+	for _, cc := range ccs {
+		plugin.ConcurrencyControls = append(plugin.ConcurrencyControls, ConcurrencyControl{
+			Regex:          cc.Regex,
+			Duration:       cc.Duration,
+			MaxConcurrency: cc.MaxConcurrency,
+		})
+	}
+	return plugin
+}
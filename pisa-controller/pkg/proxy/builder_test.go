@@ -16,6 +16,7 @@ package proxy
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -218,6 +219,15 @@ var tsReadWriteSplttingDynamic = client.TrafficStrategy{
 							},
 						},
 					},
+					Corrector: &client.Corrector{
+						Interval:            1 * time.Hour,
+						BatchSize:           500,
+						Concurrency:         2,
+						DivergenceThreshold: 0.01,
+						Action:              "eject",
+						TableIncludeRegex:   []string{"^orders_.*"},
+						TableExcludeRegex:   []string{"^orders_archive$"},
+					},
 				},
 			},
 		},
@@ -278,6 +288,7 @@ var expectedProxy = &Proxy{
 			Discovery: ReadWriteDiscovery{
 				MasterHighAvailablity: &MasterHighAvailablity{
 					Type:                      "mha",
+					BackendType:               BackendTypeMySQL,
 					User:                      "monitor",
 					Password:                  "monitor",
 					MonitorInterval:           1000,
@@ -296,6 +307,15 @@ var expectedProxy = &Proxy{
 					ReadOnlyMaxFailures:       3,
 				},
 			},
+			Corrector: &Corrector{
+				Interval:            1 * time.Hour,
+				BatchSize:           500,
+				Concurrency:         2,
+				DivergenceThreshold: 0.01,
+				Action:              "eject",
+				TableIncludeRegex:   []string{"^orders_.*"},
+				TableExcludeRegex:   []string{"^orders_archive$"},
+			},
 		},
 	},
 	Plugin: &Plugin{
@@ -387,7 +407,8 @@ func assertReadWriteSplittingDynamic(t *testing.T, act, exp *ReadWriteSplittingD
 	if act != nil && exp != nil {
 		return assert.Equal(t, act.DefaultTarget, exp.DefaultTarget, "defaultType should be equal") &&
 			assert.Equal(t, act.Rules, exp.Rules, "rules should be equal") &&
-			assertReadWriteDiscovery(t, act.Discovery, exp.Discovery, "discovery should be equal")
+			assertReadWriteDiscovery(t, act.Discovery, exp.Discovery, "discovery should be equal") &&
+			assert.Equal(t, act.Corrector, exp.Corrector, "corrector should be equal")
 
 	}
 	return true
@@ -395,6 +416,7 @@ func assertReadWriteSplittingDynamic(t *testing.T, act, exp *ReadWriteSplittingD
 
 func assertReadWriteDiscovery(t *testing.T, act, exp ReadWriteDiscovery, msg ...interface{}) bool {
 	return assert.Equal(t, act.Type, exp.Type, "type should be equal") &&
+		assert.Equal(t, act.BackendType, exp.BackendType, "backendType should be equal") &&
 		assert.Equal(t, act.User, exp.User, "user should be equal") &&
 		assert.Equal(t, act.Password, exp.Password, "password should be equal") &&
 		assert.Equal(t, act.MonitorInterval, exp.MonitorInterval, "monitorInterval should be equal") &&
@@ -447,6 +469,18 @@ func Test_ReadWriteSplittingDynamicConversion(t *testing.T) {
 				Namespace: "demotest",
 			},
 			Spec: client.TrafficStrategySpec{
+				Metrics: &client.Metrics{
+					ListenAddr: "0.0.0.0:9090",
+					Path:       "/metrics",
+					PrometheusExporter: &client.PrometheusExporter{
+						TLS: &client.TLSConfig{
+							CAFile:         "/etc/pisa/tls/ca.pem",
+							CertFile:       "/etc/pisa/tls/cert.pem",
+							KeyFile:        "/etc/pisa/tls/key.pem",
+							ClientAuthType: "RequireAndVerifyClientCert",
+						},
+					},
+				},
 				LoadBalance: &client.LoadBalance{
 					ReadWriteSplitting: &client.ReadWriteSplitting{
 						Dynamic: &client.ReadWriteSplittingDynamic{
@@ -539,4 +573,273 @@ func Test_ReadWriteSplittingDynamicConversion(t *testing.T) {
 	}
 
 	fmt.Printf("%s\n", string(data))
+
+	assert.NotNil(t, proxy.Metrics, "metrics should be set when the TrafficStrategy declares one")
+	assert.True(t, strings.Contains(string(data), `"prometheus_exporter"`), "emitted JSON should include the prometheus_exporter section")
+}
+
+// fakeCatalogClient is a canned CatalogClient used to exercise
+// ServiceCatalogDiscovery without talking to a real Consul/etcd cluster.
+type fakeCatalogClient struct {
+	writers, readers []string
+	index            uint64
+}
+
+func (f *fakeCatalogClient) Resolve(_ *client.ServiceCatalogDiscovery) (writers, readers []string, index uint64, err error) {
+	return f.writers, f.readers, f.index, nil
+}
+
+func Test_ServiceCatalogDiscovery(t *testing.T) {
+	tests := []struct {
+		name           string
+		catalog        *fakeCatalogClient
+		wantWriteNodes []string
+		wantReadNodes  []string
+		wantWaitIndex  uint64
+	}{
+		{
+			name:           "single writer, two readers",
+			catalog:        &fakeCatalogClient{writers: []string{"mysql-0.catalogue:3306"}, readers: []string{"mysql-1.catalogue:3306", "mysql-2.catalogue:3306"}, index: 42},
+			wantWriteNodes: []string{"mysql-0.catalogue:3306"},
+			wantReadNodes:  []string{"mysql-1.catalogue:3306", "mysql-2.catalogue:3306"},
+			wantWaitIndex:  42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &ProxyBuilder{
+				VirtualDatabaseService: vdb.Spec.Services[0],
+				TrafficStrategy: client.TrafficStrategy{
+					ObjectMeta: metav1.ObjectMeta{Name: "catalogue", Namespace: "demotest"},
+					Spec: client.TrafficStrategySpec{
+						LoadBalance: &client.LoadBalance{
+							ReadWriteSplitting: &client.ReadWriteSplitting{
+								Dynamic: &client.ReadWriteSplittingDynamic{
+									DefaultTarget: "readwrite",
+									Discovery: client.ReadWriteDiscovery{
+										ServiceCatalogDiscovery: &client.ServiceCatalogDiscovery{
+											Address:     "consul.demotest:8500",
+											ServiceName: "catalogue-mysql",
+											WriterTag:   "writer",
+											ReaderTag:   "reader",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				DatabaseEndpoints: []client.DatabaseEndpoint{dbep},
+				CatalogClient:     tt.catalog,
+			}
+
+			proxy := builder.Build()
+			assert.Equal(t, tt.wantWriteNodes, proxy.ReadWriteSplitting.Dynamic.WriteNodes, "write nodes should come from the catalog")
+			assert.Equal(t, tt.wantReadNodes, proxy.ReadWriteSplitting.Dynamic.ReadNodes, "read nodes should come from the catalog")
+			assert.Equal(t, tt.wantWaitIndex, proxy.ReadWriteSplitting.Dynamic.Discovery.ServiceCatalogDiscovery.WaitIndex, "wait index should be advanced to the catalog's cursor")
+		})
+	}
+}
+
+func Test_PlanBindings(t *testing.T) {
+	builder := &ProxyBuilder{
+		VirtualDatabaseService: vdb.Spec.Services[0],
+		TrafficStrategy: client.TrafficStrategy{
+			ObjectMeta: metav1.ObjectMeta{Name: "catalogue", Namespace: "demotest"},
+			Spec: client.TrafficStrategySpec{
+				LoadBalance: &client.LoadBalance{
+					ReadWriteSplitting: &client.ReadWriteSplitting{
+						Static: &client.ReadWriteSplittingStatic{
+							DefaultTarget: "readwrite",
+							Rules: []client.ReadWriteSplittingRule{
+								{
+									Name:   "pin-user-lookup",
+									Type:   "binding",
+									Target: "read",
+									Bindings: []client.SQLBinding{
+										{SQL: "SELECT * FROM users WHERE id = 42", Target: "read", AlgorithmName: "roundrobin"},
+										{SQL: "SELECT * FROM users WHERE id = 7", Target: "read", AlgorithmName: "roundrobin"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		DatabaseEndpoints: []client.DatabaseEndpoint{dbep},
+	}
+
+	proxy := builder.Build()
+
+	assert.Len(t, proxy.PlanBindings, 1, "both statements should collapse to a single binding entry")
+	digest := SQLDigest("SELECT * FROM users WHERE id = 42")
+	assert.Equal(t, digest, SQLDigest("SELECT * FROM users WHERE id = 7"), "digests should collapse once literals are stripped")
+	assert.Equal(t, PlanBinding{Target: "read", AlgorithmName: "roundrobin"}, proxy.PlanBindings[digest])
+}
+
+func Test_ProxyBuilder_PostgreSQL(t *testing.T) {
+	vdbPG := client.VirtualDatabaseService{
+		DatabaseService: client.DatabaseService{
+			DatabasePostgreSQL: &client.DatabasePostgreSQL{
+				Host:            "127.0.0.1",
+				Port:            5432,
+				DB:              "socksdb",
+				User:            "postgres",
+				Password:        "fake_password",
+				ServerVersion:   "14.4",
+				PoolSize:        3,
+				SSLMode:         "verify-full",
+				ApplicationName: "catalogue",
+				SearchPath:      "public",
+			},
+		},
+		Name:            "catalogue",
+		TrafficStrategy: "catalogue",
+	}
+
+	dbepPG := client.DatabaseEndpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "catalogue",
+			Namespace: "demotest",
+			Labels: map[string]string{
+				"source": "catalogue",
+			},
+		},
+		Spec: client.DatabaseEndpointSpec{
+			Database: client.Database{
+				PostgreSQL: &client.PostgreSQL{
+					DB:       "socksdb",
+					Host:     "catalogue-db.demotest",
+					Password: "fake_password",
+					Port:     5432,
+					User:     "postgres",
+				},
+			},
+		},
+	}
+
+	tsPG := client.TrafficStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalogue", Namespace: "demotest"},
+		Spec: client.TrafficStrategySpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"source": "catalogue"},
+			},
+			LoadBalance: &client.LoadBalance{
+				ReadWriteSplitting: &client.ReadWriteSplitting{
+					Static: &client.ReadWriteSplittingStatic{
+						DefaultTarget: "readwrite",
+						Rules: []client.ReadWriteSplittingRule{
+							{
+								Name:          "write-rule",
+								Regex:         []string{"^insert"},
+								Target:        "readwrite",
+								Type:          "regex",
+								AlgorithmName: "roundrobin",
+							},
+							{
+								Name:          "read-rule",
+								Target:        "read",
+								Type:          "regex",
+								AlgorithmName: "roundrobin",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	builder := &ProxyBuilder{
+		VirtualDatabaseService: vdbPG,
+		TrafficStrategy:        tsPG,
+		DatabaseEndpoints:      []client.DatabaseEndpoint{dbepPG},
+	}
+
+	proxy := builder.Build()
+
+	assert.Equal(t, BackendTypePostgreSQL, proxy.BackendType)
+	assert.Equal(t, "127.0.0.1:5432", proxy.ListenAddr)
+	assert.Equal(t, "verify-full", proxy.SSLMode)
+	assert.Equal(t, "catalogue", proxy.ApplicationName)
+	assert.Equal(t, "public", proxy.SearchPath)
+
+	require := proxy.ReadWriteSplitting.Static.Rules
+	assert.Equal(t, []string{"^select", "^with .* select"}, require[1].Regex, "postgresql read rule should default to the select/CTE regex")
+	assert.Equal(t, []string{"select .* for update"}, require[1].ExcludeRegex, "select ... for update should stay excluded from the read group")
+}
+
+func Test_ProxyBuilder_PostgreSQL_DynamicDiscovery(t *testing.T) {
+	vdbPG := client.VirtualDatabaseService{
+		DatabaseService: client.DatabaseService{
+			DatabasePostgreSQL: &client.DatabasePostgreSQL{
+				Host:          "127.0.0.1",
+				Port:          5432,
+				DB:            "socksdb",
+				User:          "postgres",
+				Password:      "fake_password",
+				ServerVersion: "14.4",
+				PoolSize:      3,
+			},
+		},
+		Name:            "catalogue",
+		TrafficStrategy: "catalogue",
+	}
+
+	dbepPG := client.DatabaseEndpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "catalogue",
+			Namespace: "demotest",
+			Labels: map[string]string{
+				"source": "catalogue",
+			},
+		},
+		Spec: client.DatabaseEndpointSpec{
+			Database: client.Database{
+				PostgreSQL: &client.PostgreSQL{
+					DB:       "socksdb",
+					Host:     "catalogue-db.demotest",
+					Password: "fake_password",
+					Port:     5432,
+					User:     "postgres",
+				},
+			},
+		},
+	}
+
+	tsPGDynamic := client.TrafficStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "catalogue", Namespace: "demotest"},
+		Spec: client.TrafficStrategySpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"source": "catalogue"},
+			},
+			LoadBalance: &client.LoadBalance{
+				ReadWriteSplitting: &client.ReadWriteSplitting{
+					Dynamic: &client.ReadWriteSplittingDynamic{
+						DefaultTarget: "readwrite",
+						Discovery: client.ReadWriteDiscovery{
+							MasterHighAvailability: &client.MasterHighAvailability{
+								User:            "monitor",
+								Password:        "monitor",
+								MonitorInterval: 1000,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	builder := &ProxyBuilder{
+		VirtualDatabaseService: vdbPG,
+		TrafficStrategy:        tsPGDynamic,
+		DatabaseEndpoints:      []client.DatabaseEndpoint{dbepPG},
+	}
+
+	proxy := builder.Build()
+
+	assert.Equal(t, BackendTypePostgreSQL, proxy.BackendType)
+	assert.NotNil(t, proxy.ReadWriteSplitting.Dynamic.Discovery.MasterHighAvailablity)
+	assert.Equal(t, BackendTypePostgreSQL, proxy.ReadWriteSplitting.Dynamic.Discovery.MasterHighAvailablity.BackendType, "MHA probe queries should switch to the postgres variant")
 }
@@ -0,0 +1,33 @@
+// Copyright 2022 SphereEx Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxy
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	literalPattern    = regexp.MustCompile(`'[^']*'|"[^"]*"|\b\d+\b`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// SQLDigest normalizes a SQL statement into a plan-binding key by stripping
+// string/numeric literals and collapsing whitespace, so that statements
+// differing only in their literal values bind to the same target.
+func SQLDigest(sql string) string {
+	normalized := literalPattern.ReplaceAllString(sql, "?")
+	normalized = whitespacePattern.ReplaceAllString(normalized, " ")
+	return strings.ToLower(strings.TrimSpace(normalized))
+}
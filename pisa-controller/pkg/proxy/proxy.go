@@ -0,0 +1,212 @@
+// Copyright 2022 SphereEx Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxy
+
+import "time"
+
+const (
+	// DatabaseEndpointRoleKey is the annotation key used on a DatabaseEndpoint
+	// to mark which role it plays in a read-write splitting group.
+	DatabaseEndpointRoleKey = "database-mesh.io/role"
+
+	ReadWriteSplittingRoleReadWrite = "readwrite"
+	ReadWriteSplittingRoleRead      = "read"
+
+	BackendTypeMySQL      = "mysql"
+	BackendTypePostgreSQL = "postgresql"
+)
+
+// Proxy is the dataplane-facing configuration produced by ProxyBuilder.Build().
+// It is serialized and handed off to pisa-proxy, so field names are kept in
+// sync with the config schema understood on that side.
+type Proxy struct {
+	Name          string `json:"name"`
+	BackendType   string `json:"backend_type"`
+	DB            string `json:"db"`
+	User          string `json:"user"`
+	Password      string `json:"password"`
+	ServerVersion string `json:"server_version,omitempty"`
+	PoolSize      int    `json:"pool_size,omitempty"`
+	ListenAddr    string `json:"listen_addr"`
+
+	// SSLMode, ApplicationName, and SearchPath are only meaningful when
+	// BackendType is postgresql.
+	SSLMode         string `json:"ssl_mode,omitempty"`
+	ApplicationName string `json:"application_name,omitempty"`
+	SearchPath      string `json:"search_path,omitempty"`
+
+	SimpleLoadBalance  *SimpleLoadBalance  `json:"simple_load_balance,omitempty"`
+	ReadWriteSplitting *ReadWriteSplitting `json:"read_write_splitting,omitempty"`
+	Plugin             *Plugin             `json:"plugin,omitempty"`
+	Metrics            *Metrics            `json:"metrics,omitempty"`
+
+	// PlanBindings maps a normalized SQL digest (see SQLDigest) to the group
+	// it is pinned to, so the dataplane can route by exact digest match
+	// before falling back to a rule's regex.
+	PlanBindings map[string]PlanBinding `json:"plan_bindings,omitempty"`
+}
+
+type PlanBinding struct {
+	Target        string `json:"target"`
+	AlgorithmName string `json:"algorithm_name,omitempty"`
+}
+
+// Metrics describes the Prometheus scrape endpoint exposed by the proxy,
+// including the optional TLS/mTLS material needed to serve it securely
+// inside a mesh.
+type Metrics struct {
+	ListenAddr         string              `json:"listen_addr"`
+	Path               string              `json:"path"`
+	PrometheusExporter *PrometheusExporter `json:"prometheus_exporter,omitempty"`
+}
+
+type PrometheusExporter struct {
+	TLS *TLSConfig `json:"tls,omitempty"`
+}
+
+// TLSConfig mirrors the CA/cert/key/client-auth fields used across the CRDs
+// for TLS-wrapped listeners.
+type TLSConfig struct {
+	CAFile         string `json:"ca_file,omitempty"`
+	CertFile       string `json:"cert_file,omitempty"`
+	KeyFile        string `json:"key_file,omitempty"`
+	ClientAuthType string `json:"client_auth_type,omitempty"`
+}
+
+type SimpleLoadBalance struct {
+	BalancerType string   `json:"balancer_type"`
+	Nodes        []string `json:"nodes"`
+}
+
+type ReadWriteSplitting struct {
+	Static  *ReadWriteSplittingStatic  `json:"static,omitempty"`
+	Dynamic *ReadWriteSplittingDynamic `json:"dynamic,omitempty"`
+}
+
+type ReadWriteSplittingStatic struct {
+	DefaultTarget string                   `json:"default_target"`
+	Rules         []ReadWriteSplittingRule `json:"rules"`
+}
+
+type ReadWriteSplittingDynamic struct {
+	DefaultTarget string                   `json:"default_target"`
+	Rules         []ReadWriteSplittingRule `json:"rules"`
+	Discovery     ReadWriteDiscovery       `json:"discovery"`
+
+	// WriteNodes and ReadNodes are populated when Discovery resolves the
+	// primary/replica set itself (e.g. ServiceCatalogDiscovery) rather than
+	// relying on the statically declared DatabaseEndpoints.
+	WriteNodes []string `json:"write_nodes,omitempty"`
+	ReadNodes  []string `json:"read_nodes,omitempty"`
+
+	// Corrector configures the periodic job that samples rows from each
+	// read replica against the writer to catch silent replication drift
+	// beyond what replication-lag probing alone would notice.
+	Corrector *Corrector `json:"corrector,omitempty"`
+}
+
+type Corrector struct {
+	Interval            time.Duration `json:"interval"`
+	BatchSize           int           `json:"batch_size"`
+	Concurrency         int           `json:"concurrency"`
+	DivergenceThreshold float64       `json:"divergence_threshold"`
+
+	// Action is one of "eject", "log", or "repair".
+	Action string `json:"action"`
+
+	TableIncludeRegex []string `json:"table_include_regex,omitempty"`
+	TableExcludeRegex []string `json:"table_exclude_regex,omitempty"`
+}
+
+type ReadWriteSplittingRule struct {
+	Name   string   `json:"name"`
+	Regex  []string `json:"regex"`
+	Target string   `json:"target"`
+	Type   string   `json:"type"`
+	// ExcludeRegex opts a statement back out of a rule it would otherwise
+	// match, e.g. excluding "select ... for update" from a PostgreSQL
+	// read-routing rule's broader select match.
+	ExcludeRegex  []string `json:"exclude_regex,omitempty"`
+	AlgorithmName string   `json:"algorithm_name"`
+}
+
+// ReadWriteDiscovery embeds the configured discovery mechanism. MHA-style
+// probing is the original mechanism and its fields are promoted so callers
+// can keep addressing them as discovery.Xxx; ServiceCatalogDiscovery is an
+// alternative that resolves endpoints from an external service catalog
+// instead of probing DatabaseEndpoint CRs. The builder does not reject a
+// strategy that configures both; it then emits both.
+type ReadWriteDiscovery struct {
+	*MasterHighAvailablity `json:",inline"`
+
+	ServiceCatalogDiscovery *ServiceCatalogDiscovery `json:"service_catalog_discovery,omitempty"`
+}
+
+// ServiceCatalogDiscovery watches a Consul/etcd-backed service catalog for
+// the current writer/reader endpoint set of a MySQL cluster.
+type ServiceCatalogDiscovery struct {
+	Address     string `json:"address"`
+	ACLToken    string `json:"acl_token,omitempty"`
+	ServiceName string `json:"service_name"`
+	WriterTag   string `json:"writer_tag"`
+	ReaderTag   string `json:"reader_tag"`
+
+	// WaitIndex is the blocking-query cursor used to long-poll the catalog
+	// for changes instead of re-fetching the full set every interval.
+	WaitIndex uint64 `json:"wait_index,omitempty"`
+}
+
+type MasterHighAvailablity struct {
+	Type string `json:"type"`
+	// BackendType selects the probe queries the dataplane runs, e.g.
+	// "SHOW SLAVE STATUS" for mysql vs. pg_is_in_recovery()/
+	// pg_last_wal_replay_lsn() for postgresql.
+	BackendType string `json:"backend_type"`
+	User        string `json:"user"`
+	Password    string `json:"password"`
+
+	MonitorInterval int `json:"monitor_interval"`
+
+	ConnectInterval    int `json:"connect_interval"`
+	ConnectTimeout     int `json:"connect_timeout"`
+	ConnectMaxFailures int `json:"connect_max_failures"`
+
+	PingInterval    int `json:"ping_interval"`
+	PingTimeout     int `json:"ping_timeout"`
+	PingMaxFailures int `json:"ping_max_failures"`
+
+	ReplicationLagInterval    int `json:"replication_lag_interval"`
+	ReplicationLagTimeout     int `json:"replication_lag_timeout"`
+	ReplicationLagMaxFailures int `json:"replication_lag_max_failures"`
+	MaxReplicationLag         int `json:"max_replication_lag"`
+
+	ReadOnlyInterval    int `json:"read_only_interval"`
+	ReadOnlyTimeout     int `json:"read_only_timeout"`
+	ReadOnlyMaxFailures int `json:"read_only_max_failures"`
+}
+
+type Plugin struct {
+	CircuitBreaks       []CircuitBreak       `json:"circuit_breaks,omitempty"`
+	ConcurrencyControls []ConcurrencyControl `json:"concurrency_controls,omitempty"`
+}
+
+type CircuitBreak struct {
+	Regex []string `json:"regex"`
+}
+
+type ConcurrencyControl struct {
+	Regex          []string      `json:"regex"`
+	Duration       time.Duration `json:"duration"`
+	MaxConcurrency int           `json:"max_concurrency"`
+}